@@ -0,0 +1,178 @@
+// Copyright (c) 2015-2021 MinIO, Inc.
+//
+// This file is part of MinIO Object Storage stack
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package http
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// BackendKind selects what a Backend does with a connection a RouteFunc
+// has routed.
+type BackendKind int
+
+const (
+	// BackendLocal serves the connection locally: Accept returns it to the
+	// caller, which completes the TLS handshake itself, as if no
+	// multiplexing had happened. A connection that does not start with a
+	// TLS ClientHello is never routed; routeConn returns an error for it.
+	BackendLocal BackendKind = iota
+
+	// BackendSplice dials Dial and splices the raw, still unhandshaked
+	// bytes between the client and the dialed connection; the connection
+	// is fully handled internally and never returned from Accept.
+	BackendSplice
+)
+
+// Backend describes how a RouteFunc wants a connection handled once its
+// TLS ClientHello (ALPN protocols, SNI server name) has been inspected.
+type Backend struct {
+	Kind BackendKind
+
+	// Dial opens the upstream connection for BackendSplice. Required when
+	// Kind is BackendSplice, ignored otherwise.
+	Dial func() (net.Conn, error)
+}
+
+// RouteFunc decides, from a peeked TLS ClientHello, how a connection
+// should be handled: served locally, or spliced through to another
+// backend untouched. It must not block on I/O against the connection
+// itself; hello is a point-in-time snapshot.
+type RouteFunc func(hello *tls.ClientHelloInfo) (Backend, error)
+
+// errHelloSniffed aborts the sniffing TLS handshake in peekClientHello as
+// soon as GetConfigForClient has seen the ClientHello, before any key
+// exchange happens.
+var errHelloSniffed = errors.New("http: ClientHello sniffed")
+
+// helloReaderConn overrides Read to serve from r instead of the embedded
+// net.Conn, so the same underlying bytes can be replayed to a later reader
+// without being consumed by the net.Conn directly.
+type helloReaderConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c *helloReaderConn) Read(b []byte) (int, error) { return c.r.Read(b) }
+
+// discardWriteConn is used only while sniffing a ClientHello in
+// peekClientHello: the stdlib TLS server's Handshake, on seeing
+// errHelloSniffed come back from GetConfigForClient, calls sendAlert
+// before returning the error, which writes a fatal TLS alert straight to
+// the conn it was given. Since the real handshake hasn't happened yet and
+// must still succeed afterward, that alert must never reach the actual
+// client; serving Read from r (the recording tee) and discarding every
+// Write keeps the sniff from producing any observable side effect on the
+// wire.
+type discardWriteConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c *discardWriteConn) Read(b []byte) (int, error)  { return c.r.Read(b) }
+func (c *discardWriteConn) Write(b []byte) (int, error) { return len(b), nil }
+
+// peekClientHello reads conn's TLS ClientHello using the standard library's
+// own TLS record/handshake parser (via tls.Server's GetConfigForClient
+// callback), then returns a net.Conn that replays every byte consumed
+// during that peek ahead of the rest of the stream, so a later, real TLS
+// handshake over the returned conn sees the ClientHello again from the
+// start.
+func peekClientHello(conn net.Conn) (*tls.ClientHelloInfo, net.Conn, error) {
+	var recorded bytes.Buffer
+	sniffConn := &discardWriteConn{Conn: conn, r: io.TeeReader(conn, &recorded)}
+
+	var hello *tls.ClientHelloInfo
+	err := tls.Server(sniffConn, &tls.Config{
+		GetConfigForClient: func(ch *tls.ClientHelloInfo) (*tls.Config, error) {
+			hello = &tls.ClientHelloInfo{
+				ServerName:      ch.ServerName,
+				SupportedProtos: append([]string(nil), ch.SupportedProtos...),
+			}
+			return nil, errHelloSniffed
+		},
+	}).Handshake()
+
+	if hello == nil {
+		if err != nil {
+			return nil, nil, fmt.Errorf("http: reading TLS ClientHello: %w", err)
+		}
+		return nil, nil, fmt.Errorf("http: reading TLS ClientHello: no ClientHello observed")
+	}
+
+	replay := io.MultiReader(bytes.NewReader(recorded.Bytes()), conn)
+	return hello, &helloReaderConn{Conn: conn, r: replay}, nil
+}
+
+// routeConn peeks conn's TLS ClientHello and dispatches it according to
+// route. It returns the conn (with the ClientHello bytes intact) when the
+// connection should be served locally, or a nil conn when it was spliced to
+// another backend and fully handled here.
+func routeConn(conn net.Conn, route RouteFunc) (net.Conn, error) {
+	hello, replayConn, err := peekClientHello(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	backend, err := route(hello)
+	if err != nil {
+		return nil, fmt.Errorf("http: routing connection from %s: %w", conn.RemoteAddr(), err)
+	}
+
+	if backend.Kind == BackendSplice {
+		// A spliced connection is handed off for the rest of its
+		// (potentially long-lived) life and never passes back through
+		// httpListener's HandshakeTimeout-clearing code on the
+		// BackendLocal path, so clear it here: otherwise every spliced
+		// gRPC/raw-TCP-passthrough connection would be killed with an
+		// i/o timeout once HandshakeTimeout elapses, no matter how long
+		// it's meant to live.
+		replayConn.SetDeadline(time.Time{})
+		go spliceBackend(replayConn, backend)
+		return nil, nil
+	}
+
+	return replayConn, nil
+}
+
+// spliceBackend dials backend.Dial and copies bytes in both directions
+// between conn and the dialed connection until either side closes, taking
+// ownership of conn (and closing it) in the process.
+func spliceBackend(conn net.Conn, backend Backend) {
+	defer conn.Close()
+
+	upstream, err := backend.Dial()
+	if err != nil {
+		return
+	}
+	defer upstream.Close()
+
+	done := make(chan struct{}, 2)
+	copyAndSignal := func(dst, src net.Conn) {
+		io.Copy(dst, src)
+		done <- struct{}{}
+	}
+	go copyAndSignal(upstream, conn)
+	go copyAndSignal(conn, upstream)
+	<-done
+}
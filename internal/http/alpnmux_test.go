@@ -0,0 +1,146 @@
+// Copyright (c) 2015-2021 MinIO, Inc.
+//
+// This file is part of MinIO Object Storage stack
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package http
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+// generateTestCertificate returns a minimal self-signed certificate, valid
+// for "example.com", usable as a tls.Config.Certificates entry in tests.
+func generateTestCertificate(t *testing.T) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating test key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		DNSNames:     []string{"example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("creating test certificate: %v", err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// TestRouteConnLocalHandshakeSucceeds is the regression test for the bug
+// where peekClientHello's sniffing tls.Server wrote a fatal TLS alert
+// straight to the client socket: tls.Server(...).Handshake() calls
+// sendAlert before returning the error produced by GetConfigForClient
+// (crypto/tls's handshake_server.go), and since the original
+// helloReaderConn only overrode Read, that alert reached the real client
+// and killed its handshake before the replayed, real one ever started. A
+// real tls.Client dialed against routeConn's returned conn must complete
+// its handshake normally and see the original ClientHello's SNI honored.
+func TestRouteConnLocalHandshakeSucceeds(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+
+	cert := generateTestCertificate(t)
+	var gotServerName string
+
+	serverDone := make(chan error, 1)
+	go func() {
+		routed, err := routeConn(serverConn, func(hello *tls.ClientHelloInfo) (Backend, error) {
+			gotServerName = hello.ServerName
+			return Backend{Kind: BackendLocal}, nil
+		})
+		if err != nil {
+			serverDone <- err
+			return
+		}
+		tlsServer := tls.Server(routed, &tls.Config{Certificates: []tls.Certificate{cert}})
+		serverDone <- tlsServer.Handshake()
+	}()
+
+	tlsClient := tls.Client(clientConn, &tls.Config{ServerName: "example.com", InsecureSkipVerify: true})
+	if err := tlsClient.Handshake(); err != nil {
+		t.Fatalf("client handshake failed: %v", err)
+	}
+	defer tlsClient.Close()
+
+	if err := <-serverDone; err != nil {
+		t.Fatalf("server handshake failed: %v", err)
+	}
+	if gotServerName != "example.com" {
+		t.Fatalf("route func saw SNI %q, want %q", gotServerName, "example.com")
+	}
+}
+
+// fakeConn is a net.Conn whose deadline methods are observable by tests,
+// without the complexity of a real socket pair.
+type fakeConn struct {
+	net.Conn
+	deadlineCleared bool
+}
+
+func (c *fakeConn) SetDeadline(t time.Time) error {
+	if t.IsZero() {
+		c.deadlineCleared = true
+	}
+	return nil
+}
+
+// TestRouteConnSpliceClearsDeadline is the regression test for
+// HandshakeTimeout's absolute deadline never being cleared on the
+// BackendSplice path: spliceBackend never clears it, so a long-lived
+// spliced connection (the gRPC/raw-TCP-passthrough use case) would be
+// killed with an i/o timeout once HandshakeTimeout elapsed.
+func TestRouteConnSpliceClearsDeadline(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	fc := &fakeConn{Conn: serverConn}
+
+	go tls.Client(clientConn, &tls.Config{InsecureSkipVerify: true}).Handshake()
+
+	routed, err := routeConn(fc, func(hello *tls.ClientHelloInfo) (Backend, error) {
+		return Backend{Kind: BackendSplice, Dial: func() (net.Conn, error) {
+			return nil, errors.New("test: refuse to dial")
+		}}, nil
+	})
+	if err != nil {
+		t.Fatalf("routeConn: %v", err)
+	}
+	if routed != nil {
+		t.Fatalf("expected nil conn for a spliced connection, got %v", routed)
+	}
+	if !fc.deadlineCleared {
+		t.Fatal("expected routeConn to clear the HandshakeTimeout deadline before splicing")
+	}
+}
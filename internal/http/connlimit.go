@@ -0,0 +1,215 @@
+// Copyright (c) 2015-2021 MinIO, Inc.
+//
+// This file is part of MinIO Object Storage stack
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package http
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+// ConnGate lets callers veto an accepted connection before it is handed to
+// the server, layered on top of the built-in MaxConns/MaxConnsPerIP caps
+// for custom admission control (e.g. denylists, rate limiting).
+type ConnGate interface {
+	// Allow is called once per accepted connection, after the built-in
+	// connection caps passed. Returning false rejects the connection; the
+	// listener closes it immediately.
+	Allow(conn net.Conn) bool
+}
+
+// ConnLimitMode selects what a connLimiter does with a connection once a
+// configured MaxConns/MaxConnsPerIP cap is already saturated.
+type ConnLimitMode int
+
+const (
+	// ConnLimitReject closes the connection immediately, the moment a cap
+	// is hit, the rough equivalent of the client seeing a connection
+	// reset. This is the default.
+	ConnLimitReject ConnLimitMode = iota
+
+	// ConnLimitBackpressure holds the connection open, without admitting
+	// it, until capacity frees up, the listener is closed, or
+	// TCPOptions.HandshakeTimeout elapses, instead of rejecting it
+	// outright. Because admission now happens off the shared Accept()
+	// path (see httpListener.start), blocking here only delays the one
+	// connection waiting, not every other pending one.
+	ConnLimitBackpressure
+)
+
+// ListenerStats reports point-in-time connection admission counters for a
+// httpListener. The same counters are also exported as Prometheus metrics
+// (see metrics.go) for scraping; Stats exists for callers that want the
+// numbers in-process, e.g. an admin info API.
+type ListenerStats struct {
+	Accepted uint64
+	Rejected uint64
+	Current  uint64
+}
+
+// connLimiter enforces TCPOptions.MaxConns and MaxConnsPerIP over accepted
+// connections and tracks the counters returned by httpListener.Stats. A nil
+// *connLimiter is valid and admits every connection, so callers don't need
+// to special-case the unconfigured case.
+type connLimiter struct {
+	maxConns      int
+	maxConnsPerIP int
+	mode          ConnLimitMode
+	name          string // "listener" label value on the Prometheus series in metrics.go
+
+	mu       sync.Mutex
+	total    int
+	perIP    map[string]int
+	accepted uint64
+	rejected uint64
+	freed    chan struct{} // closed and replaced every time release() runs, waking ConnLimitBackpressure waiters
+}
+
+// newConnLimiter returns a connLimiter honoring opts, or nil when neither
+// MaxConns nor MaxConnsPerIP is set. name labels this limiter's Prometheus
+// series (see metrics.go) so it can be told apart from other listeners'.
+func newConnLimiter(opts TCPOptions, name string) *connLimiter {
+	if opts.MaxConns <= 0 && opts.MaxConnsPerIP <= 0 {
+		return nil
+	}
+	return &connLimiter{
+		maxConns:      opts.MaxConns,
+		maxConnsPerIP: opts.MaxConnsPerIP,
+		mode:          opts.ConnLimitMode,
+		name:          name,
+		perIP:         make(map[string]int),
+		freed:         make(chan struct{}),
+	}
+}
+
+// admit reserves capacity for conn, blocking until capacity is available
+// when the limiter is configured with ConnLimitBackpressure (honoring ctx
+// cancellation, e.g. the listener closing while a connection waits). When
+// ok is true, the caller must eventually invoke release exactly once
+// (typically on Close) to free the reservation; when ok is false, a
+// configured cap was hit under ConnLimitReject, or ctx was canceled while
+// waiting under ConnLimitBackpressure, and the caller should reject the
+// connection.
+func (cl *connLimiter) admit(ctx context.Context, conn net.Conn) (release func(), ok bool) {
+	if cl == nil {
+		return func() {}, true
+	}
+
+	ip, perIPApplies := ipFromAddr(conn.RemoteAddr())
+
+	for {
+		cl.mu.Lock()
+		full := (cl.maxConns > 0 && cl.total >= cl.maxConns) ||
+			(perIPApplies && cl.maxConnsPerIP > 0 && cl.perIP[ip] >= cl.maxConnsPerIP)
+
+		if !full {
+			cl.total++
+			if perIPApplies {
+				cl.perIP[ip]++
+			}
+			cl.accepted++
+			current := cl.total
+			cl.mu.Unlock()
+
+			connsAccepted.WithLabelValues(cl.name).Inc()
+			connsCurrent.WithLabelValues(cl.name).Set(float64(current))
+
+			var once sync.Once
+			release = func() {
+				once.Do(func() {
+					cl.mu.Lock()
+					cl.total--
+					if perIPApplies {
+						cl.perIP[ip]--
+						if cl.perIP[ip] <= 0 {
+							delete(cl.perIP, ip)
+						}
+					}
+					current := cl.total
+					freed := cl.freed
+					cl.freed = make(chan struct{})
+					cl.mu.Unlock()
+
+					connsCurrent.WithLabelValues(cl.name).Set(float64(current))
+					close(freed)
+				})
+			}
+			return release, true
+		}
+
+		if cl.mode != ConnLimitBackpressure {
+			cl.rejected++
+			cl.mu.Unlock()
+			connsRejected.WithLabelValues(cl.name).Inc()
+			return nil, false
+		}
+
+		freed := cl.freed
+		cl.mu.Unlock()
+
+		select {
+		case <-freed:
+			continue
+		case <-ctx.Done():
+			cl.mu.Lock()
+			cl.rejected++
+			cl.mu.Unlock()
+			connsRejected.WithLabelValues(cl.name).Inc()
+			return nil, false
+		}
+	}
+}
+
+func (cl *connLimiter) stats() ListenerStats {
+	if cl == nil {
+		return ListenerStats{}
+	}
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	return ListenerStats{Accepted: cl.accepted, Rejected: cl.rejected, Current: uint64(cl.total)}
+}
+
+// ipFromAddr extracts the source IP MaxConnsPerIP should bucket addr
+// under. ok is false for addresses MaxConnsPerIP does not apply to: Unix-
+// domain connections are unnamed (addr.String() is "" for every one of
+// them), so without this they'd all collide into a single bucket and
+// MaxConnsPerIP would silently become a global cap on Unix-socket traffic,
+// contradicting its documented "ignored for Unix-domain addresses".
+func ipFromAddr(addr net.Addr) (ip string, ok bool) {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP.String(), true
+	case *net.UnixAddr:
+		return "", false
+	default:
+		return addr.String(), true
+	}
+}
+
+// limitedConn releases its connLimiter reservation exactly once, the first
+// time Close is called.
+type limitedConn struct {
+	net.Conn
+	release func()
+	once    sync.Once
+}
+
+func (c *limitedConn) Close() error {
+	c.once.Do(c.release)
+	return c.Conn.Close()
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2015-2021 MinIO, Inc.
+//
+// This file is part of MinIO Object Storage stack
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package http
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// dummyConn is a minimal net.Conn stub carrying only the RemoteAddr that
+// connLimiter.admit needs; every other method is unused here.
+type dummyConn struct {
+	net.Conn
+	addr net.Addr
+}
+
+func (c *dummyConn) RemoteAddr() net.Addr { return c.addr }
+
+func conn(ip string) net.Conn {
+	return &dummyConn{addr: &net.TCPAddr{IP: net.ParseIP(ip)}}
+}
+
+func TestConnLimiterReleaseWakesBackpressureWaiter(t *testing.T) {
+	cl := newConnLimiter(TCPOptions{MaxConns: 1, ConnLimitMode: ConnLimitBackpressure}, "test")
+
+	release1, ok := cl.admit(context.Background(), conn("203.0.113.1"))
+	if !ok {
+		t.Fatal("expected first admit to succeed")
+	}
+
+	admitted := make(chan bool, 1)
+	go func() {
+		_, ok := cl.admit(context.Background(), conn("203.0.113.2"))
+		admitted <- ok
+	}()
+
+	select {
+	case <-admitted:
+		t.Fatal("second admit returned before capacity was released")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	release1()
+
+	select {
+	case ok := <-admitted:
+		if !ok {
+			t.Fatal("expected second admit to succeed after release")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("release did not wake the blocked admit")
+	}
+}
+
+func TestConnLimiterPerIPCapIndependentOfGlobalCap(t *testing.T) {
+	cl := newConnLimiter(TCPOptions{MaxConns: 10, MaxConnsPerIP: 1}, "test")
+
+	if _, ok := cl.admit(context.Background(), conn("203.0.113.1")); !ok {
+		t.Fatal("expected first connection from 203.0.113.1 to be admitted")
+	}
+
+	if _, ok := cl.admit(context.Background(), conn("203.0.113.1")); ok {
+		t.Fatal("expected second connection from 203.0.113.1 to be rejected by MaxConnsPerIP")
+	}
+
+	if _, ok := cl.admit(context.Background(), conn("203.0.113.2")); !ok {
+		t.Fatal("expected connection from a different source IP to be admitted")
+	}
+}
+
+func TestConnLimiterContextCancelUnblocksWaiter(t *testing.T) {
+	cl := newConnLimiter(TCPOptions{MaxConns: 1, ConnLimitMode: ConnLimitBackpressure}, "test")
+
+	if _, ok := cl.admit(context.Background(), conn("203.0.113.1")); !ok {
+		t.Fatal("expected first admit to succeed")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan bool, 1)
+	go func() {
+		_, ok := cl.admit(ctx, conn("203.0.113.2"))
+		done <- ok
+	}()
+
+	cancel()
+
+	select {
+	case ok := <-done:
+		if ok {
+			t.Fatal("expected admit to fail once its context was canceled")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("canceling ctx did not unblock the waiting admit")
+	}
+}
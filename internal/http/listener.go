@@ -18,9 +18,11 @@
 package http
 
 import (
+	"bufio"
 	"context"
 	"fmt"
 	"net"
+	"os"
 	"syscall"
 	"time"
 
@@ -33,16 +35,19 @@ type acceptResult struct {
 	lidx int
 }
 
-// httpListener - HTTP listener capable of handling multiple server addresses.
+// httpListener - HTTP listener capable of handling multiple server addresses,
+// TCP and Unix-domain alike.
 type httpListener struct {
-	opts         TCPOptions
-	tcpListeners []*net.TCPListener // underlying TCP listeners.
-	acceptCh     chan acceptResult  // channel where all TCP listeners write accepted connection.
-	ctx          context.Context
-	ctxCanceler  context.CancelFunc
+	opts          TCPOptions
+	listeners     []netListener // underlying listeners.
+	listenerAddrs []string      // serverAddrs entries, parallel to listeners.
+	acceptCh      chan acceptResult
+	ctx           context.Context
+	ctxCanceler   context.CancelFunc
+	connLimiter   *connLimiter // enforces opts.MaxConns / MaxConnsPerIP, nil if unconfigured.
 }
 
-// start - starts separate goroutine for each TCP listener.  A valid new connection is passed to httpListener.acceptCh.
+// start - starts separate goroutine for each listener.  A valid new connection is passed to httpListener.acceptCh.
 func (listener *httpListener) start() {
 	// Closure to send acceptResult to acceptCh.
 	// It returns true if the result is sent else false if returns when doneCh is closed.
@@ -56,42 +61,152 @@ func (listener *httpListener) start() {
 		}
 	}
 
-	// Closure to handle TCPListener until done channel is closed.
-	handleListener := func(idx int, tcpListener *net.TCPListener) {
+	// processConn runs everything that can block on client I/O - admission
+	// (which can itself block under ConnLimitBackpressure), the
+	// HandshakeTimeout-bounded PROXY protocol header peek and TLS
+	// ClientHello sniff, and sends the finished connection to acceptCh.
+	//
+	// This runs in its own goroutine per accepted connection rather than
+	// inline in Accept() so that one slow or malicious handshake only
+	// delays its own goroutine, not every other connection waiting to be
+	// handed to the server; net/http.Server.Serve calls Accept() in a
+	// single serial loop, so anything done there serializes across all
+	// listeners (including the AcceptShards-sharded ones).
+	processConn := func(idx int, conn net.Conn) {
+		if tcpConn, ok := conn.(*net.TCPConn); ok {
+			tcpConn.SetKeepAlive(true)
+		}
+
+		// admitCtx bounds time spent blocked inside admit() under
+		// ConnLimitBackpressure by HandshakeTimeout, same as every other
+		// stage of admission below. Without this, a connection arriving
+		// while MaxConns/MaxConnsPerIP is already saturated would wait
+		// inside admit() bounded only by listener.ctx (i.e. the whole
+		// listener shutting down) while already holding an accepted fd
+		// and a live processConn goroutine open indefinitely — exactly
+		// the resource-exhaustion shape ("a burst of idle TLS clients can
+		// exhaust goroutines") HandshakeTimeout exists to prevent.
+		admitCtx := listener.ctx
+		if listener.opts.HandshakeTimeout > 0 {
+			var cancel context.CancelFunc
+			admitCtx, cancel = context.WithTimeout(listener.ctx, listener.opts.HandshakeTimeout)
+			defer cancel()
+		}
+
+		release, ok := listener.connLimiter.admit(admitCtx, conn)
+		if !ok {
+			conn.Close()
+			return
+		}
+		if listener.opts.ConnGate != nil && !listener.opts.ConnGate.Allow(conn) {
+			release()
+			conn.Close()
+			return
+		}
+
+		lconn := net.Conn(&limitedConn{Conn: conn, release: release})
+
+		// HandshakeTimeout also bounds everything from here on, up to and
+		// including the PROXY-protocol and ClientHello peeking, all of
+		// which block on reads from the client before the connection is
+		// considered "started". Only once that's done do we hand off to
+		// ClientReadTimeout for steady-state idle detection; wrapping
+		// with deadlineconn any earlier would reset the deadline to
+		// ClientReadTimeout on the very first peeked read and silently
+		// defeat HandshakeTimeout.
+		if listener.opts.HandshakeTimeout > 0 {
+			lconn.SetDeadline(time.Now().Add(listener.opts.HandshakeTimeout))
+		}
+
+		pconn, err := wrapProxyProtocol(lconn, listener.opts)
+		if err != nil {
+			if listener.opts.Trace != nil {
+				listener.opts.Trace(fmt.Sprint("wrapProxyProtocol: ", err.Error()))
+			}
+			return
+		}
+
+		fconn := pconn
+		if listener.opts.Route != nil {
+			routed, rerr := routeConn(pconn, listener.opts.Route)
+			if rerr != nil {
+				if listener.opts.Trace != nil {
+					listener.opts.Trace(fmt.Sprint("routeConn: ", rerr.Error()))
+				}
+				pconn.Close()
+				return
+			}
+			if routed == nil {
+				// Spliced to another backend; fully handled.
+				return
+			}
+			fconn = routed
+		}
+
+		if listener.opts.HandshakeTimeout > 0 && fconn == lconn {
+			// Nothing above has read from the client yet, so wait for its
+			// first byte here, still under HandshakeTimeout.
+			br := bufio.NewReader(fconn)
+			if _, err := br.Peek(1); err != nil {
+				fconn.Close()
+				return
+			}
+			fconn = &proxyProtoConn{Conn: fconn, r: br}
+		}
+		if listener.opts.HandshakeTimeout > 0 {
+			fconn.SetDeadline(time.Time{})
+		}
+		if listener.opts.ClientReadTimeout > 0 {
+			fconn = deadlineconn.New(fconn).WithReadDeadline(listener.opts.ClientReadTimeout)
+		}
+
+		send(acceptResult{fconn, nil, idx})
+	}
+
+	// Closure to handle a listener until done channel is closed.
+	handleListener := func(idx int, l netListener) {
 		for {
-			tcpConn, err := tcpListener.AcceptTCP()
-			if tcpConn != nil {
-				tcpConn.SetKeepAlive(true)
+			conn, err := l.Accept()
+			if err != nil {
+				if !send(acceptResult{nil, err, idx}) {
+					return
+				}
+				continue
 			}
-			send(acceptResult{tcpConn, err, idx})
+			go processConn(idx, conn)
 		}
 	}
 
-	// Start separate goroutine for each TCP listener to handle connection.
-	for idx, tcpListener := range listener.tcpListeners {
-		go handleListener(idx, tcpListener)
+	// Start separate goroutine for each listener to handle connections.
+	for idx, l := range listener.listeners {
+		go handleListener(idx, l)
 	}
 }
 
-// Accept - reads from httpListener.acceptCh for one of previously accepted TCP connection and returns the same.
+// Accept - reads from httpListener.acceptCh for one of previously accepted
+// connections and returns the same. Connections that exceed
+// opts.MaxConns/MaxConnsPerIP, that fail PROXY-protocol/ALPN peeking, that
+// opts.ConnGate vetoes, or that opts.Route splices to another backend are
+// closed (or handed off) by the producer goroutine in start() and never
+// reach acceptCh.
 func (listener *httpListener) Accept() (conn net.Conn, err error) {
 	select {
 	case result, ok := <-listener.acceptCh:
-		if ok {
-			return deadlineconn.New(result.conn).
-				WithReadDeadline(listener.opts.ClientReadTimeout), result.err
+		if !ok {
+			return nil, syscall.EINVAL
 		}
+		return result.conn, result.err
 	case <-listener.ctx.Done():
+		return nil, syscall.EINVAL
 	}
-	return nil, syscall.EINVAL
 }
 
-// Close - closes underneath all TCP listeners.
+// Close - closes underneath all listeners.
 func (listener *httpListener) Close() (err error) {
 	listener.ctxCanceler()
 
-	for i := range listener.tcpListeners {
-		listener.tcpListeners[i].Close()
+	for i := range listener.listeners {
+		listener.listeners[i].Close()
 	}
 
 	return nil
@@ -99,12 +214,17 @@ func (listener *httpListener) Close() (err error) {
 
 // Addr - net.Listener interface compatible method returns net.Addr.  In case of multiple TCP listeners, it returns '0.0.0.0' as IP address.
 func (listener *httpListener) Addr() (addr net.Addr) {
-	addr = listener.tcpListeners[0].Addr()
-	if len(listener.tcpListeners) == 1 {
+	addr = listener.listeners[0].Addr()
+	if len(listener.listeners) == 1 {
 		return addr
 	}
 
-	tcpAddr := addr.(*net.TCPAddr)
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		// Unix-domain addresses have no meaningful way to combine, just
+		// report the first one.
+		return addr
+	}
 	if ip := net.ParseIP("0.0.0.0"); ip != nil {
 		tcpAddr.IP = ip
 	}
@@ -113,10 +233,16 @@ func (listener *httpListener) Addr() (addr net.Addr) {
 	return addr
 }
 
-// Addrs - returns all address information of TCP listeners.
+// Stats - returns point-in-time connection admission counters, reflecting
+// opts.MaxConns/MaxConnsPerIP. Zero valued when neither is configured.
+func (listener *httpListener) Stats() ListenerStats {
+	return listener.connLimiter.stats()
+}
+
+// Addrs - returns all address information of the underlying listeners.
 func (listener *httpListener) Addrs() (addrs []net.Addr) {
-	for i := range listener.tcpListeners {
-		addrs = append(addrs, listener.tcpListeners[i].Addr())
+	for i := range listener.listeners {
+		addrs = append(addrs, listener.listeners[i].Addr())
 	}
 
 	return addrs
@@ -128,27 +254,142 @@ type TCPOptions struct {
 	ClientReadTimeout time.Duration    // When the net.Conn is idle for more than ReadTimeout duration, we close the connection on the client proactively.
 	Interface         string           // this is a VRF device passed via `--interface` flag
 	Trace             func(msg string) // Trace when starting.
+
+	// Name identifies this listener as the value of a "listener" label on
+	// the Prometheus counters/gauge in metrics.go, so operators can size
+	// MaxConns/MaxConnsPerIP independently per listener (e.g. "http",
+	// "https", "admin") instead of seeing every httpListener's numbers
+	// folded into one series. Defaults, when empty, to the first of
+	// serverAddrs that newHTTPListener opened successfully.
+	Name string
+
+	// ProxyProtocol controls whether this listener expects connections
+	// wrapped in the HAProxy PROXY protocol (v1/v2), used to recover the
+	// real client address when MinIO sits behind an L4 load balancer.
+	ProxyProtocol ProxyProtocol
+
+	// ProxyProtocolAllowlist restricts which source addresses are trusted
+	// to send a PROXY header; connections from sources outside it are
+	// treated as if ProxyProtocol were off, except under
+	// ProxyProtocolRequired, which rejects them. An empty allowlist trusts
+	// all sources.
+	ProxyProtocolAllowlist []*net.IPNet
+
+	// MaxConns caps the number of concurrent connections this listener
+	// will accept across all source addresses. Zero means unlimited.
+	MaxConns int
+
+	// MaxConnsPerIP caps the number of concurrent connections this
+	// listener will accept from a single source IP. Zero means unlimited.
+	// Ignored for Unix-domain addresses.
+	MaxConnsPerIP int
+
+	// ConnLimitMode selects what happens to a connection once MaxConns or
+	// MaxConnsPerIP is already saturated: reject it immediately (the
+	// default, ConnLimitReject) or hold it open until capacity frees up
+	// (ConnLimitBackpressure). Ignored when neither cap is set.
+	ConnLimitMode ConnLimitMode
+
+	// HandshakeTimeout bounds how long a connection may stay idle before
+	// sending its first byte (e.g. starting a TLS handshake), independent
+	// of ClientReadTimeout which governs idle time once traffic has
+	// started. Zero disables the check.
+	HandshakeTimeout time.Duration
+
+	// ConnGate, if set, is consulted for every connection that passes the
+	// MaxConns/MaxConnsPerIP checks and may veto it.
+	ConnGate ConnGate
+
+	// AcceptShards opens this many SO_REUSEPORT-bound sockets per TCP
+	// address, each with its own accept loop, instead of a single shared
+	// listener, so a high connection rate doesn't serialize on one
+	// listener's accept queue. One (no sharding) if <= 1. Linux-only;
+	// ignored for Unix-domain addresses.
+	AcceptShards int
+
+	// ReusePortSteering selects how AcceptShards > 1 sockets steer new
+	// connections across shards. Ignored when AcceptShards <= 1.
+	ReusePortSteering ReusePortMode
+
+	// Route, if set, is consulted with each connection's peeked TLS
+	// ClientHello so a single listening port can serve multiple ALPN
+	// protocols/TLS-SNI domains or splice straight through to another
+	// backend. See RouteFunc and Backend.
+	Route RouteFunc
 }
 
 // newHTTPListener - creates new httpListener object which is interface compatible to net.Listener.
 // httpListener is capable to
-// * listen to multiple addresses
+// * listen to multiple addresses, TCP (host:port) or Unix-domain
+//   (unix:///path or unixpacket://@abstract-name)
 // * controls incoming connections only doing HTTP protocol
 func newHTTPListener(ctx context.Context, serverAddrs []string, opts TCPOptions) (listener *httpListener, listenErrs []error) {
-	tcpListeners := make([]*net.TCPListener, 0, len(serverAddrs))
+	listeners := make([]netListener, 0, len(serverAddrs))
+	listenerAddrs := make([]string, 0, len(serverAddrs))
 	listenErrs = make([]error, len(serverAddrs))
 
-	// Unix listener with special TCP options.
-	listenCfg := net.ListenConfig{
-		Control: setTCPParametersFn(opts),
+	// Reuse sockets inherited from a parent process (Relaunch) or from
+	// systemd socket activation instead of binding fresh ones, so a binary
+	// upgrade or supervisor restart doesn't drop in-flight connections.
+	inherited, err := inheritedListeners(serverAddrs)
+	if err != nil {
+		if opts.Trace != nil {
+			opts.Trace(fmt.Sprint("inheritedListeners: ", err.Error()))
+		}
+		inherited = nil
 	}
 
 	for i, serverAddr := range serverAddrs {
+		if ls, ok := inherited[serverAddr]; ok {
+			if opts.Trace != nil {
+				opts.Trace(fmt.Sprint("reusing inherited listener(s) for ", serverAddr))
+			}
+			for _, l := range ls {
+				listeners = append(listeners, l)
+				listenerAddrs = append(listenerAddrs, serverAddr)
+			}
+			continue
+		}
+
+		network, address := splitNetworkAddress(serverAddr)
+
+		if network == "tcp" && opts.AcceptShards > 1 {
+			shardListeners, e := newReusePortListeners(ctx, address, opts.AcceptShards, opts)
+			if e != nil {
+				listenErrs[i] = e
+				if opts.Trace != nil {
+					opts.Trace(fmt.Sprint("newReusePortListeners: ", e.Error()))
+				}
+				continue
+			}
+			for _, nl := range shardListeners {
+				if opts.Trace != nil {
+					opts.Trace(fmt.Sprint("adding SO_REUSEPORT shard listener to ", nl.Addr()))
+				}
+				listeners = append(listeners, nl)
+				listenerAddrs = append(listenerAddrs, serverAddr)
+			}
+			continue
+		}
+
+		// Unix listener with special TCP options; Control is a no-op for
+		// Unix-domain networks since TCPOptions only tune the TCP stack.
+		listenCfg := net.ListenConfig{}
+		if network == "tcp" {
+			listenCfg.Control = setTCPParametersFn(opts)
+		}
+		if isUnixNetwork(network) {
+			// Remove a stale socket file left behind by a previous,
+			// uncleanly stopped process; harmless (and a no-op) for
+			// abstract addresses, which are not backed by a file.
+			os.Remove(address)
+		}
+
 		var (
 			l net.Listener
 			e error
 		)
-		if l, e = listenCfg.Listen(ctx, "tcp", serverAddr); e != nil {
+		if l, e = listenCfg.Listen(ctx, network, address); e != nil {
 			if opts.Trace != nil {
 				opts.Trace(fmt.Sprint("listenCfg.Listen: ", e.Error()))
 			}
@@ -157,33 +398,41 @@ func newHTTPListener(ctx context.Context, serverAddrs []string, opts TCPOptions)
 			continue
 		}
 
-		tcpListener, ok := l.(*net.TCPListener)
+		nl, ok := l.(netListener)
 		if !ok {
-			listenErrs[i] = fmt.Errorf("unexpected listener type found %v, expected net.TCPListener", l)
+			listenErrs[i] = fmt.Errorf("unexpected listener type found %v, expected netListener", l)
 			if opts.Trace != nil {
-				opts.Trace(fmt.Sprint("net.TCPListener: ", listenErrs[i].Error()))
+				opts.Trace(fmt.Sprint("netListener: ", listenErrs[i].Error()))
 			}
 			continue
 		}
 		if opts.Trace != nil {
-			opts.Trace(fmt.Sprint("adding listener to ", tcpListener.Addr()))
+			opts.Trace(fmt.Sprint("adding listener to ", nl.Addr()))
 		}
-		tcpListeners = append(tcpListeners, tcpListener)
+		listeners = append(listeners, nl)
+		listenerAddrs = append(listenerAddrs, serverAddr)
 	}
 
-	if len(tcpListeners) == 0 {
+	if len(listeners) == 0 {
 		// No listeners initialized, no need to continue
 		return
 	}
 
+	name := opts.Name
+	if name == "" {
+		name = listenerAddrs[0]
+	}
+
 	listener = &httpListener{
-		tcpListeners: tcpListeners,
-		acceptCh:     make(chan acceptResult, len(tcpListeners)),
-		opts:         opts,
+		listeners:     listeners,
+		listenerAddrs: listenerAddrs,
+		acceptCh:      make(chan acceptResult, len(listeners)),
+		opts:          opts,
+		connLimiter:   newConnLimiter(opts, name),
 	}
 	listener.ctx, listener.ctxCanceler = context.WithCancel(ctx)
 	if opts.Trace != nil {
-		opts.Trace(fmt.Sprint("opening ", len(listener.tcpListeners), " listeners"))
+		opts.Trace(fmt.Sprint("opening ", len(listener.listeners), " listeners"))
 	}
 	listener.start()
 
@@ -0,0 +1,182 @@
+// Copyright (c) 2015-2021 MinIO, Inc.
+//
+// This file is part of MinIO Object Storage stack
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package http
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// inheritedListenerFDsEnvVar carries a comma separated list of
+	// "serverAddr=fd" pairs describing listener sockets (TCP or
+	// Unix-domain) a parent
+	// process is handing down to us across a Relaunch, keyed by the
+	// serverAddr they were originally opened for.
+	inheritedListenerFDsEnvVar = "MINIO_INHERITED_FDS"
+
+	// listenFDsEnvVar is systemd's socket activation protocol: the number
+	// of inherited sockets, starting at fd 3.
+	listenFDsEnvVar = "LISTEN_FDS"
+	listenFDsStart  = 3
+)
+
+// inheritedListeners looks for listener sockets inherited from a parent
+// process, either via MINIO_INHERITED_FDS (set by Relaunch for a
+// zero-downtime binary upgrade) or via systemd socket activation
+// (LISTEN_FDS), and reconstructs the netListener(s) for each serverAddr it
+// can match, TCP or Unix-domain alike. An address with AcceptShards > 1
+// appears multiple times, once per inherited shard socket. Addresses not
+// found in the result should be bound fresh.
+func inheritedListeners(serverAddrs []string) (map[string][]netListener, error) {
+	result := make(map[string][]netListener)
+
+	if v := os.Getenv(inheritedListenerFDsEnvVar); v != "" {
+		for _, pair := range strings.Split(v, ",") {
+			addr, fdStr, ok := strings.Cut(pair, "=")
+			if !ok {
+				return nil, fmt.Errorf("http: malformed %s entry %q", inheritedListenerFDsEnvVar, pair)
+			}
+			fd, err := strconv.Atoi(fdStr)
+			if err != nil {
+				return nil, fmt.Errorf("http: malformed fd in %s entry %q: %w", inheritedListenerFDsEnvVar, pair, err)
+			}
+			l, err := listenerFromFD(fd, addr)
+			if err != nil {
+				return nil, err
+			}
+			result[addr] = append(result[addr], l)
+		}
+		return result, nil
+	}
+
+	if n, err := strconv.Atoi(os.Getenv(listenFDsEnvVar)); err == nil && n > 0 {
+		for i := 0; i < n && i < len(serverAddrs); i++ {
+			l, err := listenerFromFD(listenFDsStart+i, serverAddrs[i])
+			if err != nil {
+				return nil, err
+			}
+			result[serverAddrs[i]] = append(result[serverAddrs[i]], l)
+		}
+	}
+
+	return result, nil
+}
+
+// listenerFromFD reconstructs a netListener from an inherited file
+// descriptor, as handed down by a parent process via os.StartProcess Files
+// or by systemd socket activation. net.FileListener determines the
+// underlying socket type (TCP or Unix-domain) from the fd itself.
+func listenerFromFD(fd int, addr string) (netListener, error) {
+	f := os.NewFile(uintptr(fd), addr)
+	if f == nil {
+		return nil, fmt.Errorf("http: invalid inherited fd %d for %s", fd, addr)
+	}
+	defer f.Close()
+
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("http: reconstructing listener from inherited fd %d for %s: %w", fd, addr, err)
+	}
+
+	nl, ok := l.(netListener)
+	if !ok {
+		l.Close()
+		return nil, fmt.Errorf("http: inherited fd %d for %s is not a supported listener type", fd, addr)
+	}
+
+	return nl, nil
+}
+
+// Relaunch re-executes the current binary, passing this listener's
+// underlying sockets down as inherited file descriptors so the new
+// process can take over accepting on them without rebinding. This is the
+// first half of a zero-downtime binary upgrade: once the child is up,
+// callers should stop accepting on listener (see Reload) and let in-flight
+// requests drain before exiting the parent.
+func (listener *httpListener) Relaunch() (*os.Process, error) {
+	files := make([]*os.File, len(listener.listeners))
+	pairs := make([]string, len(listener.listeners))
+	for i, l := range listener.listeners {
+		f, err := l.File()
+		if err != nil {
+			for _, opened := range files[:i] {
+				opened.Close()
+			}
+			return nil, fmt.Errorf("http: dup'ing listener fd for %s: %w", listener.listenerAddrs[i], err)
+		}
+		files[i] = f
+		// os.StartProcess always places ProcAttr.Files starting at fd 0,
+		// and we reserve 0-2 for stdio, so inherited sockets start at 3.
+		// Keyed by the original serverAddr (not l.Addr(), whose string form
+		// may not round-trip, e.g. a bare ":9000" or a Unix socket path
+		// without its "unix://" scheme) so the child can match it back up.
+		pairs[i] = fmt.Sprintf("%s=%d", listener.listenerAddrs[i], listenFDsStart+i)
+	}
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	execPath, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("http: resolving current executable: %w", err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("http: resolving current working directory: %w", err)
+	}
+
+	env := append(os.Environ(), inheritedListenerFDsEnvVar+"="+strings.Join(pairs, ","))
+
+	p, err := os.StartProcess(execPath, os.Args, &os.ProcAttr{
+		Dir:   wd,
+		Env:   env,
+		Files: append([]*os.File{os.Stdin, os.Stdout, os.Stderr}, files...),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("http: relaunching %s: %w", execPath, err)
+	}
+
+	return p, nil
+}
+
+// Reload relaunches a child process that inherits this listener's sockets,
+// stops listener from accepting further connections, and invokes
+// onShutdown (if any) with hammerTime so the caller can drain in-flight
+// requests before exiting. It returns the child *os.Process so the caller
+// can track or wait on it.
+func (listener *httpListener) Reload(hammerTime time.Duration, onShutdown func(time.Duration)) (*os.Process, error) {
+	p, err := listener.Relaunch()
+	if err != nil {
+		return nil, err
+	}
+
+	listener.Close()
+	if onShutdown != nil {
+		onShutdown(hammerTime)
+	}
+
+	return p, nil
+}
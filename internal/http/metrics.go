@@ -0,0 +1,51 @@
+// Copyright (c) 2015-2021 MinIO, Inc.
+//
+// This file is part of MinIO Object Storage stack
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package http
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Prometheus counters/gauge mirroring connLimiter's in-memory ListenerStats,
+// so the same MaxConns/MaxConnsPerIP admission numbers httpListener.Stats
+// reports in-process are also scrapeable. Each series carries a "listener"
+// label (TCPOptions.Name, see newConnLimiter) so operators can size
+// MaxConns/MaxConnsPerIP independently per httpListener (HTTP, HTTPS,
+// admin, ...) instead of every listener's numbers folding into one series.
+var (
+	connsAccepted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "minio",
+		Subsystem: "http_listener",
+		Name:      "conns_accepted_total",
+		Help:      "Total connections admitted past MaxConns/MaxConnsPerIP.",
+	}, []string{"listener"})
+	connsRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "minio",
+		Subsystem: "http_listener",
+		Name:      "conns_rejected_total",
+		Help:      "Total connections rejected or dropped while waiting under MaxConns/MaxConnsPerIP.",
+	}, []string{"listener"})
+	connsCurrent = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "minio",
+		Subsystem: "http_listener",
+		Name:      "conns_current",
+		Help:      "Connections currently admitted past MaxConns/MaxConnsPerIP.",
+	}, []string{"listener"})
+)
+
+func init() {
+	prometheus.MustRegister(connsAccepted, connsRejected, connsCurrent)
+}
@@ -0,0 +1,240 @@
+// Copyright (c) 2015-2021 MinIO, Inc.
+//
+// This file is part of MinIO Object Storage stack
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ProxyProtocol controls whether a listener expects incoming connections to
+// be wrapped in the HAProxy PROXY protocol, used to recover the real client
+// address when MinIO is deployed behind an L4 load balancer (HAProxy, AWS
+// NLB) that would otherwise present its own address as the peer.
+type ProxyProtocol string
+
+const (
+	// ProxyProtocolOff disables PROXY protocol handling; the TCP peer
+	// address is used as-is. This is the default.
+	ProxyProtocolOff ProxyProtocol = ""
+
+	// ProxyProtocolOptional parses a PROXY header when the connection
+	// starts with one, but also accepts connections that do not.
+	ProxyProtocolOptional ProxyProtocol = "optional"
+
+	// ProxyProtocolRequired rejects any connection that does not start
+	// with a valid PROXY header.
+	ProxyProtocolRequired ProxyProtocol = "required"
+)
+
+// proxyProtocolV2Sig is the fixed 12-byte signature that prefixes every
+// PROXY protocol v2 header.
+var proxyProtocolV2Sig = []byte{0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A}
+
+// proxyProtoConn overrides RemoteAddr() with the source address recovered
+// from a PROXY protocol header, while serving reads through r so that any
+// bytes already buffered past the header are not lost.
+type proxyProtoConn struct {
+	net.Conn
+	r       *bufio.Reader
+	srcAddr net.Addr
+}
+
+func (c *proxyProtoConn) Read(b []byte) (int, error) { return c.r.Read(b) }
+
+func (c *proxyProtoConn) RemoteAddr() net.Addr {
+	if c.srcAddr != nil {
+		return c.srcAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// isTrustedProxySource reports whether addr is allowed to send a PROXY
+// header; an empty allowlist trusts every source.
+func isTrustedProxySource(allowlist []*net.IPNet, addr net.Addr) bool {
+	if len(allowlist) == 0 {
+		return true
+	}
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, n := range allowlist {
+		if n.Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// wrapProxyProtocol inspects conn for a PROXY protocol v1/v2 header
+// according to opts.ProxyProtocol, returning a net.Conn whose RemoteAddr()
+// reflects the real client address when a header is found. Connections
+// from sources outside opts.ProxyProtocolAllowlist are passed through
+// unchanged unless the mode is ProxyProtocolRequired.
+func wrapProxyProtocol(conn net.Conn, opts TCPOptions) (net.Conn, error) {
+	if opts.ProxyProtocol == ProxyProtocolOff {
+		return conn, nil
+	}
+
+	if !isTrustedProxySource(opts.ProxyProtocolAllowlist, conn.RemoteAddr()) {
+		if opts.ProxyProtocol == ProxyProtocolRequired {
+			conn.Close()
+			return nil, fmt.Errorf("http: PROXY protocol required but %s is not a trusted proxy", conn.RemoteAddr())
+		}
+		return conn, nil
+	}
+
+	r := bufio.NewReaderSize(conn, proxyProtocolV1MaxLen+1) // largest possible PROXY v1 header ("\r\n" included), plus one spare byte
+
+	if sig, err := r.Peek(len(proxyProtocolV2Sig)); err == nil && bytes.Equal(sig, proxyProtocolV2Sig) {
+		srcAddr, err := parseProxyProtocolV2(r)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return &proxyProtoConn{Conn: conn, r: r, srcAddr: srcAddr}, nil
+	}
+
+	if sig, err := r.Peek(6); err == nil && string(sig) == "PROXY " {
+		srcAddr, err := parseProxyProtocolV1(r)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return &proxyProtoConn{Conn: conn, r: r, srcAddr: srcAddr}, nil
+	}
+
+	if opts.ProxyProtocol == ProxyProtocolRequired {
+		conn.Close()
+		return nil, fmt.Errorf("http: PROXY protocol required but no PROXY header was found on %s", conn.RemoteAddr())
+	}
+
+	return &proxyProtoConn{Conn: conn, r: r}, nil
+}
+
+// proxyProtocolV1MaxLen is the longest possible PROXY v1 header per spec
+// ("PROXY UNKNOWN\r\n" plus the longest IPv6 address/port fields), 107
+// bytes; r must be sized at least this large so ReadSlice can find the
+// terminating "\n" within a single fill.
+const proxyProtocolV1MaxLen = 107
+
+// parseProxyProtocolV1 parses the ASCII PROXY protocol v1 header, e.g.
+// "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n", returning the
+// advertised source address. It returns a nil address (without error) for
+// "PROXY UNKNOWN\r\n", meaning the original connection address should be
+// kept.
+//
+// r.ReadSlice, not ReadString, bounds how much is read: ReadString keeps
+// refilling and appending to an internal slice until it finds the
+// delimiter, regardless of r's buffer size, so a peer that never sends a
+// "\n" would grow memory without bound for as long as HandshakeTimeout (0,
+// disabled, by default) allows it to stay connected. ReadSlice instead
+// returns bufio.ErrBufferFull once r's buffer (sized to
+// proxyProtocolV1MaxLen+1 by the caller) fills without finding the
+// delimiter, which we treat as a malformed header.
+func parseProxyProtocolV1(r *bufio.Reader) (net.Addr, error) {
+	slice, err := r.ReadSlice('\n')
+	if err != nil {
+		if errors.Is(err, bufio.ErrBufferFull) {
+			return nil, fmt.Errorf("http: PROXY v1 header exceeds %d bytes", proxyProtocolV1MaxLen)
+		}
+		return nil, fmt.Errorf("http: reading PROXY v1 header: %w", err)
+	}
+	line := strings.TrimRight(string(slice), "\r\n")
+
+	fields := strings.Split(line, " ")
+	if len(fields) < 2 || fields[0] != "PROXY" {
+		return nil, fmt.Errorf("http: malformed PROXY v1 header %q", line)
+	}
+	if fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 {
+		return nil, fmt.Errorf("http: malformed PROXY v1 header %q", line)
+	}
+
+	srcIP := net.ParseIP(fields[2])
+	if srcIP == nil {
+		return nil, fmt.Errorf("http: invalid PROXY v1 source address %q", fields[2])
+	}
+	srcPort, err := strconv.Atoi(fields[4])
+	if err != nil {
+		return nil, fmt.Errorf("http: invalid PROXY v1 source port %q", fields[4])
+	}
+
+	return &net.TCPAddr{IP: srcIP, Port: srcPort}, nil
+}
+
+// parseProxyProtocolV2 parses the binary PROXY protocol v2 header (12-byte
+// signature already peeked by the caller, followed by a 4-byte header and
+// TLV-encoded addresses) and returns the advertised source address. It
+// returns a nil address (without error) for LOCAL connections (health
+// checks) and address families it does not recover a usable address from.
+func parseProxyProtocolV2(r *bufio.Reader) (net.Addr, error) {
+	hdr := make([]byte, 16)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return nil, fmt.Errorf("http: reading PROXY v2 header: %w", err)
+	}
+
+	verCmd := hdr[12]
+	if verCmd>>4 != 2 {
+		return nil, fmt.Errorf("http: unsupported PROXY protocol version %d", verCmd>>4)
+	}
+	cmd := verCmd & 0x0F
+	famProto := hdr[13]
+	length := binary.BigEndian.Uint16(hdr[14:16])
+
+	addrBytes := make([]byte, length)
+	if length > 0 {
+		if _, err := io.ReadFull(r, addrBytes); err != nil {
+			return nil, fmt.Errorf("http: reading PROXY v2 addresses: %w", err)
+		}
+	}
+
+	if cmd == 0x0 {
+		// LOCAL command: connection from the proxy itself (e.g. a health
+		// check), keep the original connection address.
+		return nil, nil
+	}
+
+	switch famProto >> 4 {
+	case 0x1: // AF_INET
+		if len(addrBytes) < 12 {
+			return nil, fmt.Errorf("http: short PROXY v2 IPv4 address block")
+		}
+		srcPort := binary.BigEndian.Uint16(addrBytes[8:10])
+		return &net.TCPAddr{IP: net.IP(addrBytes[0:4]), Port: int(srcPort)}, nil
+	case 0x2: // AF_INET6
+		if len(addrBytes) < 36 {
+			return nil, fmt.Errorf("http: short PROXY v2 IPv6 address block")
+		}
+		srcPort := binary.BigEndian.Uint16(addrBytes[32:34])
+		return &net.TCPAddr{IP: net.IP(addrBytes[0:16]), Port: int(srcPort)}, nil
+	default:
+		// AF_UNSPEC or unix sockets carry no usable source address here.
+		return nil, nil
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright (c) 2015-2021 MinIO, Inc.
+//
+// This file is part of MinIO Object Storage stack
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"testing"
+)
+
+func TestParseProxyProtocolV1(t *testing.T) {
+	cases := []struct {
+		name     string
+		line     string
+		wantNil  bool
+		wantErr  bool
+		wantIP   string
+		wantPort int
+	}{
+		{name: "tcp4", line: "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n", wantIP: "192.0.2.1", wantPort: 56324},
+		{name: "unknown", line: "PROXY UNKNOWN\r\n", wantNil: true},
+		{name: "missing fields", line: "PROXY TCP4 192.0.2.1\r\n", wantErr: true},
+		{name: "bad source ip", line: "PROXY TCP4 not-an-ip 198.51.100.1 56324 443\r\n", wantErr: true},
+		{name: "bad source port", line: "PROXY TCP4 192.0.2.1 198.51.100.1 not-a-port 443\r\n", wantErr: true},
+		{name: "not a proxy line", line: "GET / HTTP/1.1\r\n", wantErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			addr, err := parseProxyProtocolV1(bufio.NewReader(bytes.NewBufferString(c.line)))
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got addr=%v", addr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if c.wantNil {
+				if addr != nil {
+					t.Fatalf("expected nil addr, got %v", addr)
+				}
+				return
+			}
+			tcpAddr, ok := addr.(*net.TCPAddr)
+			if !ok {
+				t.Fatalf("expected *net.TCPAddr, got %T", addr)
+			}
+			if tcpAddr.IP.String() != c.wantIP || tcpAddr.Port != c.wantPort {
+				t.Fatalf("got %s:%d, want %s:%d", tcpAddr.IP, tcpAddr.Port, c.wantIP, c.wantPort)
+			}
+		})
+	}
+}
+
+func TestParseProxyProtocolV1Truncated(t *testing.T) {
+	// No trailing newline, but short enough to fit in the buffer: ReadSlice
+	// hits EOF before the buffer fills.
+	_, err := parseProxyProtocolV1(bufio.NewReader(bytes.NewBufferString("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443")))
+	if err == nil {
+		t.Fatal("expected error for truncated header, got nil")
+	}
+}
+
+func TestParseProxyProtocolV1Unbounded(t *testing.T) {
+	// A peer that never sends the terminating "\n" must not make
+	// parseProxyProtocolV1 buffer an unbounded amount of data; with a
+	// reader sized the way wrapProxyProtocol sizes it, the read must fail
+	// as soon as the buffer fills rather than growing without limit.
+	r := bufio.NewReaderSize(bytes.NewReader(bytes.Repeat([]byte("A"), 10*proxyProtocolV1MaxLen)), proxyProtocolV1MaxLen+1)
+
+	_, err := parseProxyProtocolV1(r)
+	if err == nil {
+		t.Fatal("expected error for a header with no terminating newline, got nil")
+	}
+}
+
+// proxyProtocolV2Header builds the 16-byte fixed portion parseProxyProtocolV2
+// expects to read (the 12-byte signature, already peeked by the caller in
+// wrapProxyProtocol, plus verCmd/famProto/length), followed by addrBytes.
+func proxyProtocolV2Header(verCmd, famProto byte, addrBytes []byte) []byte {
+	hdr := append([]byte(nil), proxyProtocolV2Sig...)
+	hdr = append(hdr, verCmd, famProto, byte(len(addrBytes)>>8), byte(len(addrBytes)))
+	return append(hdr, addrBytes...)
+}
+
+func TestParseProxyProtocolV2(t *testing.T) {
+	var addrBytes []byte
+	addrBytes = append(addrBytes, net.ParseIP("192.0.2.1").To4()...)
+	addrBytes = append(addrBytes, net.ParseIP("198.51.100.1").To4()...)
+	addrBytes = append(addrBytes, 0xDB, 0xFC) // src port 56316
+	addrBytes = append(addrBytes, 0x01, 0xBB) // dst port 443
+
+	v4 := proxyProtocolV2Header(0x21, 0x11, addrBytes) // ver=2 cmd=PROXY, AF_INET/STREAM
+
+	addr, err := parseProxyProtocolV2(bufio.NewReader(bytes.NewReader(v4)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		t.Fatalf("expected *net.TCPAddr, got %T", addr)
+	}
+	if tcpAddr.IP.String() != "192.0.2.1" || tcpAddr.Port != 0xDBFC {
+		t.Fatalf("got %s:%d, want 192.0.2.1:%d", tcpAddr.IP, tcpAddr.Port, 0xDBFC)
+	}
+}
+
+func TestParseProxyProtocolV2Local(t *testing.T) {
+	local := proxyProtocolV2Header(0x20, 0x00, nil) // ver=2 cmd=LOCAL, zero-length address block
+
+	addr, err := parseProxyProtocolV2(bufio.NewReader(bytes.NewReader(local)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if addr != nil {
+		t.Fatalf("expected nil addr for LOCAL command, got %v", addr)
+	}
+}
+
+func TestParseProxyProtocolV2Truncated(t *testing.T) {
+	full := proxyProtocolV2Header(0x21, 0x11, make([]byte, 12))
+	truncated := full[:len(full)-4] // cut the header short, mid address block
+
+	if _, err := parseProxyProtocolV2(bufio.NewReader(bytes.NewReader(truncated))); err == nil {
+		t.Fatal("expected error for truncated v2 header, got nil")
+	}
+}
+
+func TestParseProxyProtocolV2UnsupportedVersion(t *testing.T) {
+	bad := proxyProtocolV2Header(0x11, 0x11, nil) // verCmd high nibble 1 instead of 2
+
+	if _, err := parseProxyProtocolV2(bufio.NewReader(bytes.NewReader(bad))); err == nil {
+		t.Fatal("expected error for unsupported version, got nil")
+	}
+}
+
+func TestIsTrustedProxySource(t *testing.T) {
+	_, trusted, _ := net.ParseCIDR("192.0.2.0/24")
+	allowlist := []*net.IPNet{trusted}
+
+	cases := []struct {
+		name string
+		addr net.Addr
+		want bool
+	}{
+		{name: "empty allowlist trusts all", addr: &net.TCPAddr{IP: net.ParseIP("203.0.113.1")}, want: true},
+		{name: "in allowlist", addr: &net.TCPAddr{IP: net.ParseIP("192.0.2.5")}, want: true},
+		{name: "outside allowlist", addr: &net.TCPAddr{IP: net.ParseIP("203.0.113.1")}, want: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			list := allowlist
+			if c.name == "empty allowlist trusts all" {
+				list = nil
+			}
+			if got := isTrustedProxySource(list, c.addr); got != c.want {
+				t.Fatalf("isTrustedProxySource() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
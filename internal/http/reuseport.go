@@ -0,0 +1,44 @@
+// Copyright (c) 2015-2021 MinIO, Inc.
+//
+// This file is part of MinIO Object Storage stack
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package http
+
+// ReusePortMode selects how the SO_REUSEPORT-sharded sockets opened for an
+// address (see TCPOptions.AcceptShards) steer new connections across
+// shards.
+type ReusePortMode string
+
+const (
+	// ReusePortSteeringOff relies on the kernel's default SO_REUSEPORT
+	// behavior (a hash of the connection 4-tuple) to spread new
+	// connections across shards. This is the default.
+	ReusePortSteeringOff ReusePortMode = ""
+
+	// ReusePortSteeringCBPF attaches a classic BPF program
+	// (SO_ATTACH_REUSEPORT_CBPF) to every shard socket that selects the
+	// accepting shard by hashing the connection's source port.
+	ReusePortSteeringCBPF ReusePortMode = "cbpf"
+
+	// ReusePortSteeringEBPF attaches an eBPF program
+	// (SO_ATTACH_REUSEPORT_EBPF) that can steer by CPU affinity
+	// (raw_smp_processor_id) to avoid cross-core migration between the
+	// interrupt handling a new connection and the goroutine accepting it.
+	// Not implemented on this platform/build; newHTTPListener reports an
+	// error rather than silently falling back to the kernel's default
+	// hash.
+	ReusePortSteeringEBPF ReusePortMode = "ebpf"
+)
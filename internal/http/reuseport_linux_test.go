@@ -0,0 +1,47 @@
+// Copyright (c) 2015-2021 MinIO, Inc.
+//
+// This file is part of MinIO Object Storage stack
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+//go:build linux
+
+package http
+
+import (
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestReusePortCBPFProgram(t *testing.T) {
+	for _, shards := range []int{1, 2, 4, 16} {
+		prog := reusePortCBPFProgram(shards)
+		if len(prog) != 3 {
+			t.Fatalf("shards=%d: got %d instructions, want 3", shards, len(prog))
+		}
+		if prog[0].K != tcpSourcePortOffset {
+			t.Errorf("shards=%d: load offset = %d, want %d", shards, prog[0].K, tcpSourcePortOffset)
+		}
+		if prog[0].Code != unix.BPF_LD|unix.BPF_H|unix.BPF_ABS {
+			t.Errorf("shards=%d: unexpected load instruction code %#x", shards, prog[0].Code)
+		}
+		if prog[1].K != uint32(shards) {
+			t.Errorf("shards=%d: modulus = %d, want %d", shards, prog[1].K, shards)
+		}
+		if prog[2].Code != unix.BPF_RET|unix.BPF_A {
+			t.Errorf("shards=%d: unexpected return instruction code %#x", shards, prog[2].Code)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2015-2021 MinIO, Inc.
+//
+// This file is part of MinIO Object Storage stack
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+//go:build !linux
+
+package http
+
+import (
+	"context"
+	"fmt"
+	"net"
+)
+
+// newReusePortListeners is the non-Linux fallback: SO_REUSEPORT socket
+// sharding and its steering modes are Linux-specific, so this opens a
+// single plain listener on address regardless of shards and reports an
+// error if the caller asked for BPF-based steering, rather than silently
+// ignoring it.
+func newReusePortListeners(ctx context.Context, address string, shards int, opts TCPOptions) ([]netListener, error) {
+	if opts.ReusePortSteering != ReusePortSteeringOff {
+		return nil, fmt.Errorf("http: ReusePortSteering is not supported on this platform")
+	}
+
+	lc := net.ListenConfig{Control: setTCPParametersFn(opts)}
+	l, err := lc.Listen(ctx, "tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("http: opening listener for %s: %w", address, err)
+	}
+
+	nl, ok := l.(netListener)
+	if !ok {
+		l.Close()
+		return nil, fmt.Errorf("http: unexpected listener type for %s", address)
+	}
+
+	return []netListener{nl}, nil
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2015-2021 MinIO, Inc.
+//
+// This file is part of MinIO Object Storage stack
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package http
+
+import (
+	"net"
+	"os"
+	"strings"
+)
+
+// netListener is the subset of net.Listener httpListener needs from an
+// underlying listener, plus File (used by Relaunch to hand the underlying
+// socket down across a binary upgrade). Both *net.TCPListener and
+// *net.UnixListener satisfy it, which lets a single httpListener serve a
+// mix of TCP and Unix-domain addresses.
+type netListener interface {
+	net.Listener
+	File() (*os.File, error)
+}
+
+const (
+	unixNetworkPrefix       = "unix://"
+	unixPacketNetworkPrefix = "unixpacket://"
+)
+
+// splitNetworkAddress parses a serverAddrs entry into the network and
+// address net.Listen expects. Entries of the form "unix:///path/to.sock" or
+// "unixpacket://@abstract-name" select a Unix-domain listener; anything
+// else is treated as a "host:port" TCP address. A "@"-prefixed Unix address
+// denotes a Linux abstract socket and is translated to the leading NUL byte
+// the kernel expects.
+func splitNetworkAddress(serverAddr string) (network, address string) {
+	switch {
+	case strings.HasPrefix(serverAddr, unixNetworkPrefix):
+		network, address = "unix", strings.TrimPrefix(serverAddr, unixNetworkPrefix)
+	case strings.HasPrefix(serverAddr, unixPacketNetworkPrefix):
+		network, address = "unixpacket", strings.TrimPrefix(serverAddr, unixPacketNetworkPrefix)
+	default:
+		return "tcp", serverAddr
+	}
+
+	if strings.HasPrefix(address, "@") {
+		address = "\x00" + address[1:]
+	}
+	return network, address
+}
+
+// isUnixNetwork reports whether network is one of the Unix-domain socket
+// types recognized by splitNetworkAddress.
+func isUnixNetwork(network string) bool {
+	return network == "unix" || network == "unixpacket"
+}